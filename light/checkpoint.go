@@ -0,0 +1,159 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package light
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/metrics"
+	"github.com/matrix/go-matrix/rlp"
+)
+
+var (
+	// ErrNotEnoughSigners is returned by VerifySignedAnnouncement when fewer
+	// than the checkpoint's signersThreshold valid, distinct trusted
+	// signatures are found over the announcement.
+	ErrNotEnoughSigners = errors.New("not enough trusted signatures on announcement")
+
+	// ultraLightAcceptedMeter counts announcements accepted on the strength of
+	// trusted signatures alone, skipping full PoW verification.
+	ultraLightAcceptedMeter = metrics.NewRegisteredMeter("les/ultralight/accepted", nil)
+	// ultraLightRejectedMeter counts announcements that fell back to full
+	// header verification because the trusted-signer threshold wasn't met.
+	ultraLightRejectedMeter = metrics.NewRegisteredMeter("les/ultralight/rejected", nil)
+)
+
+// signedAnnouncement is the canonical RLP payload signed by an ultra-light
+// trusted signer over a new-head announcement.
+type signedAnnouncement struct {
+	Number uint64
+	Hash   common.Hash
+	Td     *big.Int
+}
+
+// SignedAnnouncementPayload returns the canonical RLP encoding of a new-head
+// announcement (number || hash || td), the payload that trusted signers sign
+// and that VerifySignedAnnouncement checks signatures against.
+func SignedAnnouncementPayload(number uint64, hash common.Hash, td *big.Int) ([]byte, error) {
+	return rlp.EncodeToBytes(&signedAnnouncement{Number: number, Hash: hash, Td: td})
+}
+
+// VerifySignedAnnouncement reports whether at least cp.signersThreshold
+// distinct addresses in cp.trustedSigners produced one of the given
+// signatures over the announcement's canonical payload. A les peer handler
+// that receives these signatures alongside a new-head announcement can use a
+// nil result from this call in place of verifying the header's proof of
+// work, as long as enough of the operator's trusted signers vouch for it.
+//
+// This package only provides that primitive: the les peer/announcement
+// handling that would call it, and the CLI flag that would load a signer set
+// via EnableUltraLight at startup, are not part of this tree and still need
+// to be wired up before ultra-light mode does anything.
+//
+// It is a hard error (ErrNoTrustedCht-like) to call this on a checkpoint that
+// was not configured with any trusted signers.
+func (cp *trustedCheckpoint) VerifySignedAnnouncement(number uint64, hash common.Hash, td *big.Int, sigs [][]byte) error {
+	if len(cp.trustedSigners) == 0 || cp.signersThreshold == 0 {
+		return errors.New("checkpoint has no trusted signers configured")
+	}
+	payload, err := SignedAnnouncementPayload(number, hash, td)
+	if err != nil {
+		return err
+	}
+	digest := crypto.Keccak256(payload)
+
+	seen := make(map[common.Address]bool)
+	for _, sig := range sigs {
+		pubkey, err := crypto.SigToPub(digest, sig)
+		if err != nil {
+			continue
+		}
+		signer := crypto.PubkeyToAddress(*pubkey)
+		if !cp.isTrustedSigner(signer) || seen[signer] {
+			continue
+		}
+		seen[signer] = true
+	}
+	if len(seen) < cp.signersThreshold {
+		ultraLightRejectedMeter.Mark(1)
+		return ErrNotEnoughSigners
+	}
+	ultraLightAcceptedMeter.Mark(1)
+	return nil
+}
+
+// isTrustedSigner reports whether addr is one of the checkpoint's configured
+// trusted signers.
+func (cp *trustedCheckpoint) isTrustedSigner(addr common.Address) bool {
+	for _, signer := range cp.trustedSigners {
+		if signer == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// trustedSignerConfig is the JSON structure used to load a set of trusted
+// signer addresses and the signature threshold from a config file, e.g.:
+//
+//	{
+//	  "threshold": 2,
+//	  "signers": ["0x1122...", "0x3344..."]
+//	}
+type trustedSignerConfig struct {
+	Threshold int              `json:"threshold"`
+	Signers   []common.Address `json:"signers"`
+}
+
+// LoadTrustedSigners reads a trusted-signer set and threshold from a JSON
+// config file and applies it to cp, enabling ultra-light announcement
+// verification for that checkpoint.
+func (cp *trustedCheckpoint) LoadTrustedSigners(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config trustedSignerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	if config.Threshold <= 0 || config.Threshold > len(config.Signers) {
+		return errors.New("invalid trusted signer threshold")
+	}
+	cp.trustedSigners = config.Signers
+	cp.signersThreshold = config.Threshold
+	return nil
+}
+
+// EnableUltraLight loads a trusted signer set for the checkpoint associated
+// with genesisHash and enables ultra-light announcement verification for it.
+// It is meant to be called once at startup, before the light chain starts
+// accepting announcements; wiring it to an actual CLI flag or config option
+// is left to whichever command builds the light client, none of which do so
+// yet in this tree.
+func EnableUltraLight(genesisHash common.Hash, signerConfigPath string) error {
+	cp, ok := trustedCheckpoints[genesisHash]
+	if !ok {
+		return ErrNoTrustedCht
+	}
+	return cp.LoadTrustedSigners(signerConfigPath)
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package light
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/crypto"
+)
+
+func signAnnouncement(t *testing.T, key *ecdsa.PrivateKey, number uint64, hash common.Hash, td *big.Int) []byte {
+	t.Helper()
+	payload, err := SignedAnnouncementPayload(number, hash, td)
+	if err != nil {
+		t.Fatalf("SignedAnnouncementPayload failed: %v", err)
+	}
+	sig, err := crypto.Sign(crypto.Keccak256(payload), key)
+	if err != nil {
+		t.Fatalf("crypto.Sign failed: %v", err)
+	}
+	return sig
+}
+
+func TestVerifySignedAnnouncementThreshold(t *testing.T) {
+	key1, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	key2, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	unknownKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	cp := &trustedCheckpoint{
+		trustedSigners:   []common.Address{crypto.PubkeyToAddress(key1.PublicKey), crypto.PubkeyToAddress(key2.PublicKey)},
+		signersThreshold: 2,
+	}
+
+	number, hash, td := uint64(42), common.HexToHash("0x01"), big.NewInt(100)
+	sig1 := signAnnouncement(t, key1, number, hash, td)
+	sig2 := signAnnouncement(t, key2, number, hash, td)
+	sigUnknown := signAnnouncement(t, unknownKey, number, hash, td)
+
+	if err := cp.VerifySignedAnnouncement(number, hash, td, [][]byte{sig1, sigUnknown}); err != ErrNotEnoughSigners {
+		t.Fatalf("one trusted + one unknown signature: err = %v, want ErrNotEnoughSigners", err)
+	}
+	if err := cp.VerifySignedAnnouncement(number, hash, td, [][]byte{sig1, sig1}); err != ErrNotEnoughSigners {
+		t.Fatalf("same trusted signature counted twice: err = %v, want ErrNotEnoughSigners", err)
+	}
+	if err := cp.VerifySignedAnnouncement(number, hash, td, [][]byte{sig1, sig2}); err != nil {
+		t.Fatalf("two distinct trusted signatures: err = %v, want nil", err)
+	}
+
+	empty := &trustedCheckpoint{}
+	if err := empty.VerifySignedAnnouncement(number, hash, td, [][]byte{sig1, sig2}); err == nil {
+		t.Fatal("VerifySignedAnnouncement on a checkpoint with no trusted signers did not return an error")
+	}
+}
+
+func TestLoadTrustedSigners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	signers := []common.Address{common.HexToAddress("0x1111111111111111111111111111111111111111")}
+	config := trustedSignerConfig{Threshold: 1, Signers: signers}
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	path := filepath.Join(dir, "signers.json")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	cp := &trustedCheckpoint{}
+	if err := cp.LoadTrustedSigners(path); err != nil {
+		t.Fatalf("LoadTrustedSigners failed: %v", err)
+	}
+	if cp.signersThreshold != 1 || len(cp.trustedSigners) != 1 || cp.trustedSigners[0] != signers[0] {
+		t.Fatalf("LoadTrustedSigners did not populate checkpoint correctly: %+v", cp)
+	}
+
+	if err := cp.LoadTrustedSigners(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatal("LoadTrustedSigners on a missing file did not return an error")
+	}
+}
@@ -0,0 +1,380 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package light
+
+import (
+	"context"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/bitutil"
+	"github.com/matrix/go-matrix/core/rawdb"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/crypto"
+)
+
+// bloomIndexes returns the three bit indices within a BloomTrie bit vector
+// that the given piece of data (an address or a topic) sets, using the same
+// hash-derived scheme as types.Bloom.Add so light and full clients agree on
+// which bits to test.
+func bloomIndexes(data []byte) [3]uint {
+	hash := crypto.Keccak256(data)
+	var idxs [3]uint
+	for i := 0; i < 3; i++ {
+		idxs[i] = (uint(hash[2*i])<<8 | uint(hash[2*i+1])) & (types.BloomBitLength - 1)
+	}
+	return idxs
+}
+
+// bloomBitGroup collects the bit-index triples of a set of alternative items
+// (e.g. every address in a filter, or every topic acceptable at a given log
+// position). A block matches the group if it sets all 3 bits of at least one
+// item's triple (AND within a triple, OR across items) — the same rule
+// types.Bloom.Test applies to a single item.
+type bloomBitGroup [][3]uint
+
+func addressGroup(addresses []common.Address) bloomBitGroup {
+	g := make(bloomBitGroup, len(addresses))
+	for i, addr := range addresses {
+		g[i] = bloomIndexes(addr.Bytes())
+	}
+	return g
+}
+
+func topicGroup(topics []common.Hash) bloomBitGroup {
+	g := make(bloomBitGroup, len(topics))
+	for i, topic := range topics {
+		g[i] = bloomIndexes(topic.Bytes())
+	}
+	return g
+}
+
+// filterGroups builds the AND-of-ORs bit index groups that MatchLogs tests a
+// section's bloom bit vectors against: the address group (skipped if no
+// addresses were requested, matching everything) and one group per topic
+// position (skipped for wildcard positions, i.e. an empty topics[i]).
+func filterGroups(addresses []common.Address, topics [][]common.Hash) []bloomBitGroup {
+	var groups []bloomBitGroup
+	if len(addresses) > 0 {
+		groups = append(groups, addressGroup(addresses))
+	}
+	for _, t := range topics {
+		if len(t) > 0 {
+			groups = append(groups, topicGroup(t))
+		}
+	}
+	return groups
+}
+
+// requiredBitIndexes returns the deduplicated set of bit indices that need to
+// be fetched from the BloomTrie to evaluate all of the given groups.
+func requiredBitIndexes(groups []bloomBitGroup) []uint {
+	seen := make(map[uint]bool)
+	var out []uint
+	for _, g := range groups {
+		for _, item := range g {
+			for _, idx := range item {
+				if !seen[idx] {
+					seen[idx] = true
+					out = append(out, idx)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// sectionFetch is the result of retrieving and decompressing every bit vector
+// a single BloomTrie section needs to evaluate filterGroups against it.
+type sectionFetch struct {
+	section uint64
+	bits    map[uint][]byte // bitIdx -> decompressed per-block bit vector for this section
+	err     error
+}
+
+// fetchSectionBits retrieves the decompressed bit vectors for bitIndexes out
+// of the given BloomTrie section via a single batched, multi-proof ODR round
+// trip (falling back transparently to one request per bit on older peers).
+func fetchSectionBits(ctx context.Context, odr OdrBackend, config *IndexerConfig, section uint64, bitIndexes []uint) (map[uint][]byte, error) {
+	sectionHead := rawdb.ReadCanonicalHash(odr.Database(), (section+1)*config.BloomTrieSize-1)
+	req := &BloomRequestList{
+		Config:         config,
+		BloomTrieRoot:  GetBloomTrieRoot(odr.Database(), section, sectionHead),
+		BloomTrieNum:   section,
+		BitIndices:     bitIndexes,
+		SectionIndices: make([]uint64, len(bitIndexes)),
+		SectionHeads:   make([]common.Hash, len(bitIndexes)),
+	}
+	for i := range bitIndexes {
+		req.SectionIndices[i] = section
+		req.SectionHeads[i] = sectionHead
+	}
+	if err := odr.Retrieve(ctx, req); err != nil {
+		return nil, err
+	}
+	bits := make(map[uint][]byte, len(bitIndexes))
+	for i, bitIdx := range bitIndexes {
+		decomp, err := bitutil.DecompressBytes(req.BloomBits[i], int(config.BloomTrieSize/8))
+		if err != nil {
+			return nil, err
+		}
+		bits[bitIdx] = decomp
+	}
+	return bits, nil
+}
+
+// fetchHeadersByCht retrieves the headers for every block number in nums via
+// one batched ChtRequestList round trip per covered CHT section, instead of
+// one ChtRequest (or HeaderRequest) round trip per header. Numbers that fall
+// in a CHT section this node doesn't have a root for yet (typically the most
+// recent, unconfirmed blocks) are simply left out of the returned map;
+// matchLogsInBlock falls back to a HeaderRequest for those.
+func fetchHeadersByCht(ctx context.Context, odr OdrBackend, config *IndexerConfig, nums []uint64) (map[uint64]*types.Header, error) {
+	bySection := make(map[uint64][]uint64)
+	for _, num := range nums {
+		section := num / config.ChtSize
+		bySection[section] = append(bySection[section], num)
+	}
+	chtIndexer := odr.ChtIndexer()
+	sectionCount, _, _ := chtIndexer.Sections()
+
+	headers := make(map[uint64]*types.Header, len(nums))
+	for section, blockNums := range bySection {
+		if section >= sectionCount {
+			continue
+		}
+		sectionHead := chtIndexer.SectionHead(section)
+		req := &ChtRequestList{Config: config, ChtRoot: GetChtRoot(odr.Database(), section, sectionHead), ChtNum: section, BlockNums: blockNums}
+		if err := odr.Retrieve(ctx, req); err != nil {
+			return nil, err
+		}
+		for i, num := range blockNums {
+			headers[num] = req.Headers[i]
+		}
+	}
+	return headers, nil
+}
+
+// testBit reports whether the bit for the given block offset is set in a
+// decompressed per-section bit vector, using the same big-endian, MSB-first
+// bit layout core/bloombits.Generator writes blocks in.
+func testBit(vec []byte, block uint64) bool {
+	byteIdx := block / 8
+	if byteIdx >= uint64(len(vec)) {
+		return false
+	}
+	return vec[byteIdx]&(0x80>>(block%8)) != 0
+}
+
+// candidateBlocks ANDs together the per-group matches to produce the set of
+// block numbers (relative to the section's first block) that might contain a
+// matching log, based only on their bloom bits. A block matches a group if it
+// matches at least one of the group's items (OR across items), and it
+// matches an item if all 3 of the item's bits are set (AND within a triple) —
+// exactly the test types.Bloom.Test applies to a single address or topic.
+func candidateBlocks(groups []bloomBitGroup, bits map[uint][]byte, blocksInSection uint64) []uint64 {
+	match := make([]bool, blocksInSection)
+	for i := range match {
+		match[i] = true
+	}
+	for _, g := range groups {
+		groupMatch := make([]bool, blocksInSection)
+		for _, item := range g {
+			v0, v1, v2 := bits[item[0]], bits[item[1]], bits[item[2]]
+			for block := uint64(0); block < blocksInSection; block++ {
+				if !groupMatch[block] && testBit(v0, block) && testBit(v1, block) && testBit(v2, block) {
+					groupMatch[block] = true
+				}
+			}
+		}
+		for block := range match {
+			match[block] = match[block] && groupMatch[block]
+		}
+	}
+	var candidates []uint64
+	for block, ok := range match {
+		if ok {
+			candidates = append(candidates, uint64(block))
+		}
+	}
+	return candidates
+}
+
+// MatchLogs searches for logs matching addresses and topics between blocks
+// from and to (inclusive) using the BloomTrie instead of scanning the local
+// bloom-bits database block by block. For each covered BloomTrie section it
+// fetches only the bit vectors the filter actually needs, narrows the section
+// down to a handful of candidate blocks using the combined bitmap, and only
+// then retrieves and re-checks the headers/receipts of those candidates
+// (bloom bits can false-positive, never false-negative).
+//
+// Section fetches are pipelined: up to one section's worth of ODR round trips
+// is in flight ahead of the one currently being matched, and everything stops
+// as soon as ctx is done.
+func MatchLogs(ctx context.Context, odr OdrBackend, addresses []common.Address, topics [][]common.Hash, from, to uint64) ([]*types.Log, error) {
+	config := odr.IndexerConfig()
+	groups := filterGroups(addresses, topics)
+	bitIndexes := requiredBitIndexes(groups)
+
+	firstSection, lastSection := from/config.BloomTrieSize, to/config.BloomTrieSize
+
+	results := make(chan sectionFetch, 2)
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		defer close(results)
+		for section := firstSection; section <= lastSection; section++ {
+			bits, err := fetchSectionBits(fetchCtx, odr, config, section, bitIndexes)
+			select {
+			case results <- sectionFetch{section: section, bits: bits, err: err}:
+			case <-fetchCtx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var logs []*types.Log
+	for fetch := range results {
+		if fetch.err != nil {
+			return nil, fetch.err
+		}
+		sectionFirst := fetch.section * config.BloomTrieSize
+		var nums []uint64
+		for _, rel := range candidateBlocks(groups, fetch.bits, config.BloomTrieSize) {
+			if num := sectionFirst + rel; num >= from && num <= to {
+				nums = append(nums, num)
+			}
+		}
+		if len(nums) == 0 {
+			continue
+		}
+		headers, err := fetchHeadersByCht(ctx, odr, config, nums)
+		if err != nil {
+			return nil, err
+		}
+		for _, num := range nums {
+			matched, err := matchLogsInBlock(ctx, odr, num, headers[num], addresses, topics)
+			if err != nil {
+				return nil, err
+			}
+			logs = append(logs, matched...)
+		}
+	}
+	return logs, nil
+}
+
+// matchLogsInBlock returns the logs of block num that actually satisfy the
+// filter, re-checking against the precise header bloom and log data rather
+// than trusting the BloomTrie's probabilistic bit match. header may be nil,
+// e.g. for a block not yet covered by a CHT section, in which case it is
+// fetched individually via a HeaderRequest.
+func matchLogsInBlock(ctx context.Context, odr OdrBackend, num uint64, header *types.Header, addresses []common.Address, topics [][]common.Hash) ([]*types.Log, error) {
+	if header == nil {
+		hreq := &HeaderRequest{Number: num}
+		if err := odr.Retrieve(ctx, hreq); err != nil {
+			return nil, err
+		}
+		header = hreq.Header
+	}
+	if !headerBloomMayMatch(header.Bloom, addresses, topics) {
+		return nil, nil
+	}
+	rreq := &ReceiptsRequest{Hash: header.Hash(), Number: num}
+	if err := odr.Retrieve(ctx, rreq); err != nil {
+		return nil, err
+	}
+	var logs []*types.Log
+	for _, receipt := range rreq.Receipts {
+		for _, log := range receipt.Logs {
+			if logMatches(log, addresses, topics) {
+				logs = append(logs, log)
+			}
+		}
+	}
+	return logs, nil
+}
+
+// headerBloomMayMatch cheaply rules out a header whose own 2048-bit bloom
+// cannot possibly satisfy the filter, before paying for a receipts fetch.
+func headerBloomMayMatch(bloom types.Bloom, addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 {
+		match := false
+		for _, addr := range addresses {
+			if bloom.Test(addr.Bytes()) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	for _, t := range topics {
+		if len(t) == 0 {
+			continue
+		}
+		match := false
+		for _, topic := range t {
+			if bloom.Test(topic.Bytes()) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
+
+// logMatches reports whether log satisfies the address and topic filter.
+func logMatches(log *types.Log, addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 {
+		match := false
+		for _, addr := range addresses {
+			if log.Address == addr {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	if len(topics) > len(log.Topics) {
+		return false
+	}
+	for i, t := range topics {
+		if len(t) == 0 {
+			continue
+		}
+		match := false
+		for _, topic := range t {
+			if log.Topics[i] == topic {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package light
+
+import (
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/types"
+)
+
+func TestBloomIndexesDeterministicAndInRange(t *testing.T) {
+	addr := common.HexToAddress("0x1234567890123456789012345678901234567890")
+	idxs1 := bloomIndexes(addr.Bytes())
+	idxs2 := bloomIndexes(addr.Bytes())
+	if idxs1 != idxs2 {
+		t.Fatalf("bloomIndexes is not deterministic: %v != %v", idxs1, idxs2)
+	}
+	for _, idx := range idxs1 {
+		if idx >= types.BloomBitLength {
+			t.Fatalf("index %d out of range [0, %d)", idx, types.BloomBitLength)
+		}
+	}
+}
+
+func TestTestBit(t *testing.T) {
+	// byte 0 = 0b10100000 sets bits 0 and 2 (MSB-first).
+	vec := []byte{0xA0}
+	for _, block := range []uint64{0, 2} {
+		if !testBit(vec, block) {
+			t.Errorf("testBit(vec, %d) = false, want true", block)
+		}
+	}
+	for _, block := range []uint64{1, 3, 4, 5, 6, 7} {
+		if testBit(vec, block) {
+			t.Errorf("testBit(vec, %d) = true, want false", block)
+		}
+	}
+	if testBit(vec, 8) {
+		t.Error("testBit reported a set bit past the end of the vector")
+	}
+}
+
+// bitsVector builds a decompressed per-section bit vector of the given
+// bit-length with exactly the given blocks set, using testBit's MSB-first
+// layout.
+func bitsVector(bitLen uint64, blocks ...uint64) []byte {
+	vec := make([]byte, (bitLen+7)/8)
+	for _, b := range blocks {
+		vec[b/8] |= 0x80 >> (b % 8)
+	}
+	return vec
+}
+
+func TestCandidateBlocksAndWithinTripleOrAcrossItems(t *testing.T) {
+	const blocksInSection = 8
+	// Group A (e.g. a single address): triple {1,2,3}. Bits 1 and 2 are set
+	// for blocks 0-3, but bit 3 only for blocks 0-1 — without ANDing all 3
+	// bits of the triple, blocks 2 and 3 would wrongly match too.
+	// Group B (e.g. two acceptable topic values at one position): item
+	// {4,5,6} matches only block 2, item {7,8,9} matches only block 1 — only
+	// ORing across items recovers both as possible matches for the group.
+	groups := []bloomBitGroup{
+		{{1, 2, 3}},
+		{{4, 5, 6}, {7, 8, 9}},
+	}
+	bits := map[uint][]byte{
+		1: bitsVector(blocksInSection, 0, 1, 2, 3),
+		2: bitsVector(blocksInSection, 0, 1, 2, 3),
+		3: bitsVector(blocksInSection, 0, 1),
+		4: bitsVector(blocksInSection, 2),
+		5: bitsVector(blocksInSection, 2),
+		6: bitsVector(blocksInSection, 2),
+		7: bitsVector(blocksInSection, 1),
+		8: bitsVector(blocksInSection, 1),
+		9: bitsVector(blocksInSection, 1),
+	}
+
+	// Group A alone (AND within the triple) matches blocks {0,1}; group B
+	// alone (OR across its two items) matches blocks {1,2}. The final result
+	// is their intersection: only block 1.
+	got := candidateBlocks(groups, bits, blocksInSection)
+	want := []uint64{1}
+	if len(got) != len(want) {
+		t.Fatalf("candidateBlocks = %v, want %v", got, want)
+	}
+	for i, v := range want {
+		if got[i] != v {
+			t.Fatalf("candidateBlocks = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package light
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/trie"
+)
+
+// MultiProofCap is the LES handshake capability name a peer advertises to
+// indicate it understands the compact multi-key proof format produced by
+// MultiProof.Encode. Servers must fall back to sending one independent proof
+// per key for any peer that does not advertise it.
+const MultiProofCap = "mpf"
+
+// ErrKeyValueMismatch is returned by VerifyMultiProof when the number of keys
+// and values supplied by the caller don't match.
+var ErrKeyValueMismatch = errors.New("light: key/value count mismatch in multi-proof")
+
+// MultiProof encodes or verifies a Merkle proof for multiple keys of the same
+// trie root as a single, deduplicated set of trie nodes, instead of the N
+// independent (and heavily overlapping) proofs the single-key code path
+// would produce. It is the wire format CHT and BloomTrie ODR requests use
+// once both peers have negotiated MultiProofCap during the LES handshake.
+type MultiProof struct{}
+
+// Encode walks trie t once per key, recording every node touched along the
+// way into a shared NodeSet, and returns the deduplicated node list. Because
+// NodeSet.Put is a no-op for a hash it has already seen, any interior node
+// shared between two keys' paths (which, for logically related keys such as
+// consecutive CHT entries or BloomTrie bit indices, is most of the proof) is
+// only included once.
+func (MultiProof) Encode(t *trie.Trie, keys [][]byte) ([][]byte, error) {
+	nodes := NewNodeSet()
+	for _, key := range keys {
+		if err := t.Prove(key, 0, nodes); err != nil {
+			return nil, err
+		}
+	}
+	return nodes.NodeList(), nil
+}
+
+// VerifyMultiProof checks that every (keys[i], values[i]) pair is provable
+// against root using only the shared node set in nodes, as produced by
+// Encode. It fails closed: any key that can't be resolved, or whose resolved
+// value doesn't match, makes the whole batch invalid.
+func VerifyMultiProof(root common.Hash, keys [][]byte, values [][]byte, nodes [][]byte) error {
+	if len(keys) != len(values) {
+		return ErrKeyValueMismatch
+	}
+	proofDb := NewNodeSetFromList(nodes)
+	for i, key := range keys {
+		val, _, err := trie.VerifyProof(root, key, proofDb)
+		if err != nil {
+			return fmt.Errorf("key %x: %v", key, err)
+		}
+		if !bytes.Equal(val, values[i]) {
+			return fmt.Errorf("key %x: value mismatch", key)
+		}
+	}
+	return nil
+}
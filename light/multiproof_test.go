@@ -0,0 +1,87 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package light
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/trie"
+)
+
+func TestMultiProofEncodeVerify(t *testing.T) {
+	triedb := trie.NewDatabase(mandb.NewMemDatabase())
+	tr, err := trie.New(common.Hash{}, triedb)
+	if err != nil {
+		t.Fatalf("trie.New failed: %v", err)
+	}
+
+	var keys, values [][]byte
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("key-%02d", i))
+		value := []byte(fmt.Sprintf("value-%02d", i))
+		tr.Update(key, value)
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	root, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	nodes, err := (MultiProof{}).Encode(tr, keys)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if len(nodes) == 0 {
+		t.Fatal("Encode returned no nodes")
+	}
+
+	if err := VerifyMultiProof(root, keys, values, nodes); err != nil {
+		t.Fatalf("VerifyMultiProof failed: %v", err)
+	}
+}
+
+func TestMultiProofVerifyKeyValueMismatch(t *testing.T) {
+	err := VerifyMultiProof(common.Hash{}, [][]byte{[]byte("a")}, nil, nil)
+	if err != ErrKeyValueMismatch {
+		t.Fatalf("err = %v, want ErrKeyValueMismatch", err)
+	}
+}
+
+func TestMultiProofVerifyRejectsTamperedValue(t *testing.T) {
+	triedb := trie.NewDatabase(mandb.NewMemDatabase())
+	tr, err := trie.New(common.Hash{}, triedb)
+	if err != nil {
+		t.Fatalf("trie.New failed: %v", err)
+	}
+	key, value := []byte("key"), []byte("value")
+	tr.Update(key, value)
+	root, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	nodes, err := (MultiProof{}).Encode(tr, [][]byte{key})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if err := VerifyMultiProof(root, [][]byte{key}, [][]byte{[]byte("wrong")}, nodes); err == nil {
+		t.Fatal("VerifyMultiProof accepted a tampered value")
+	}
+}
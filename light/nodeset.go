@@ -0,0 +1,140 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2015 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package light
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/mandb"
+)
+
+// errNotFound is returned by NodeSet.Get when the requested node is not part
+// of the set.
+var errNotFound = errors.New("key not found in node set")
+
+// NodeSet stores a set of trie nodes keyed by their hash, as collected while
+// generating or consuming a Merkle proof. It implements trie.DatabaseWriter so
+// a proof can be produced directly into one, and Store copies the collected
+// nodes into a real trie.Database so a light trie can be opened on top of them.
+type NodeSet struct {
+	lock     sync.RWMutex
+	nodes    map[string][]byte
+	dataSize int
+}
+
+// NewNodeSet creates an empty node set
+func NewNodeSet() *NodeSet {
+	return &NodeSet{
+		nodes: make(map[string][]byte),
+	}
+}
+
+// Put stores a new node in the set
+func (db *NodeSet) Put(key []byte, value []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if _, ok := db.nodes[string(key)]; ok {
+		return nil
+	}
+	keyCopy := common.CopyBytes(key)
+	valueCopy := common.CopyBytes(value)
+	db.nodes[string(keyCopy)] = valueCopy
+	db.dataSize += len(valueCopy)
+	return nil
+}
+
+// Delete removes a node from the set
+func (db *NodeSet) Delete(key []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if value, ok := db.nodes[string(key)]; ok {
+		db.dataSize -= len(value)
+		delete(db.nodes, string(key))
+	}
+	return nil
+}
+
+// Get returns a stored node
+func (db *NodeSet) Get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if entry, ok := db.nodes[string(key)]; ok {
+		return entry, nil
+	}
+	return nil, errNotFound
+}
+
+// Has returns true if the node set contains the given key
+func (db *NodeSet) Has(key []byte) (bool, error) {
+	_, err := db.Get(key)
+	return err == nil, nil
+}
+
+// KeyCount returns the number of nodes in the set
+func (db *NodeSet) KeyCount() int {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return len(db.nodes)
+}
+
+// DataSize returns the aggregated data size of nodes in the set
+func (db *NodeSet) DataSize() int {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.dataSize
+}
+
+// NodeList converts the node set to a flat list of encoded nodes, deduplicated
+// and in no particular order. It is the on-the-wire representation of a proof.
+func (db *NodeSet) NodeList() [][]byte {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var values [][]byte
+	for _, value := range db.nodes {
+		values = append(values, value)
+	}
+	return values
+}
+
+// Store writes the contents of the set to the given database
+func (db *NodeSet) Store(target mandb.Putter) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	for key, value := range db.nodes {
+		target.Put([]byte(key), value)
+	}
+}
+
+// NewNodeSetFromList recreates a NodeSet from a flat list of encoded trie
+// nodes received over the wire, keying each one by its keccak256 hash.
+func NewNodeSetFromList(list [][]byte) *NodeSet {
+	db := NewNodeSet()
+	for _, node := range list {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
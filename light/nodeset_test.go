@@ -0,0 +1,97 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2015 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package light
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/matrix/go-matrix/crypto"
+)
+
+func TestNodeSetPutGetHas(t *testing.T) {
+	db := NewNodeSet()
+	key, value := []byte("key"), []byte("value")
+	if ok, _ := db.Has(key); ok {
+		t.Fatal("Has reported true on an empty set")
+	}
+	if err := db.Put(key, value); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if ok, _ := db.Has(key); !ok {
+		t.Fatal("Has reported false after Put")
+	}
+	got, err := db.Get(key)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Fatalf("Get returned %x, want %x", got, value)
+	}
+	if db.KeyCount() != 1 {
+		t.Fatalf("KeyCount = %d, want 1", db.KeyCount())
+	}
+	if db.DataSize() != len(value) {
+		t.Fatalf("DataSize = %d, want %d", db.DataSize(), len(value))
+	}
+}
+
+func TestNodeSetPutDeduplicates(t *testing.T) {
+	db := NewNodeSet()
+	key := []byte("key")
+	db.Put(key, []byte("first"))
+	db.Put(key, []byte("second"))
+	got, _ := db.Get(key)
+	if !bytes.Equal(got, []byte("first")) {
+		t.Fatalf("second Put overwrote the first value: got %x", got)
+	}
+	if db.KeyCount() != 1 {
+		t.Fatalf("KeyCount = %d, want 1", db.KeyCount())
+	}
+}
+
+func TestNodeSetDelete(t *testing.T) {
+	db := NewNodeSet()
+	key := []byte("key")
+	db.Put(key, []byte("value"))
+	if err := db.Delete(key); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if ok, _ := db.Has(key); ok {
+		t.Fatal("Has reported true after Delete")
+	}
+	if _, err := db.Get(key); err != errNotFound {
+		t.Fatalf("Get after Delete returned err = %v, want errNotFound", err)
+	}
+}
+
+func TestNewNodeSetFromList(t *testing.T) {
+	nodes := [][]byte{[]byte("node one"), []byte("node two")}
+	db := NewNodeSetFromList(nodes)
+	if db.KeyCount() != len(nodes) {
+		t.Fatalf("KeyCount = %d, want %d", db.KeyCount(), len(nodes))
+	}
+	for _, node := range nodes {
+		got, err := db.Get(crypto.Keccak256(node))
+		if err != nil {
+			t.Fatalf("Get(keccak256(%q)) failed: %v", node, err)
+		}
+		if !bytes.Equal(got, node) {
+			t.Fatalf("Get(keccak256(%q)) = %x, want %x", node, got, node)
+		}
+	}
+}
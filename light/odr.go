@@ -0,0 +1,173 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2015 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package light implements on-demand retrieval capable state and chain
+// objects for the MATRIX light client.
+package light
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core"
+	"github.com/matrix/go-matrix/core/rawdb"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/mandb"
+)
+
+// NoOdr is the default context passed to an ODR capable function when the ODR
+// service is not required.
+var NoOdr = context.Background()
+
+// ErrNoPeers is returned if no peers capable of serving a queued request are available
+var ErrNoPeers = errors.New("no suitable peers available")
+
+// OdrBackend is an interface to a backend service that handles ODR retrieval of
+// headers, state and chain indexer helper tries (CHT, BloomTrie) on behalf of a
+// light client that does not have the requested data locally.
+type OdrBackend interface {
+	Database() mandb.Database
+	IndexerConfig() *IndexerConfig
+	ChtIndexer() *core.ChainIndexer
+	BloomTrieIndexer() *core.ChainIndexer
+	BloomIndexer() *core.ChainIndexer
+	Retrieve(ctx context.Context, req OdrRequest) error
+}
+
+// OdrRequest is an interface for retrieval requests
+type OdrRequest interface {
+	StoreResult(db mandb.Database)
+}
+
+// ChtRequest is the ODR request type for fetching a single header (plus its
+// total difficulty) out of a CHT section via a Merkle proof against the
+// section's already-known root.
+type ChtRequest struct {
+	Config           *IndexerConfig
+	ChtRoot          common.Hash
+	ChtNum, BlockNum uint64
+	Header           *types.Header
+	Td               *big.Int
+	Proof            *NodeSet
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *ChtRequest) StoreResult(db mandb.Database) {
+	hash, num := req.Header.Hash(), req.Header.Number.Uint64()
+	rawdb.WriteHeader(db, req.Header)
+	rawdb.WriteTd(db, hash, num, req.Td)
+	rawdb.WriteCanonicalHash(db, hash, num)
+}
+
+// BloomRequest is the ODR request type for retrieving compressed bloom bit
+// vectors for a single bit index out of one or more BloomTrie sub-sections via
+// a Merkle proof against the BloomTrie's already-known root.
+type BloomRequest struct {
+	Config           *IndexerConfig
+	BloomTrieNum     uint64
+	BitIdx           uint
+	SectionIndexList []uint64
+	SectionHeadList  []common.Hash
+	BloomTrieRoot    common.Hash
+	BloomBits        [][]byte
+	Proofs           *NodeSet
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *BloomRequest) StoreResult(db mandb.Database) {
+	for i, sectionIdx := range req.SectionIndexList {
+		rawdb.WriteBloomBits(db, req.BitIdx, sectionIdx, req.SectionHeadList[i], req.BloomBits[i])
+	}
+}
+
+// ChtRequestList is the ODR request type for fetching a batch of headers
+// (plus their total difficulties) out of the same CHT section via a single
+// MultiProof instead of one independent Merkle proof per header. The server
+// only replies in this format to peers that advertised MultiProofCap during
+// the LES handshake; for everyone else the request layer falls back to
+// issuing one ChtRequest per header.
+type ChtRequestList struct {
+	Config    *IndexerConfig
+	ChtRoot   common.Hash
+	ChtNum    uint64
+	BlockNums []uint64
+	Headers   []*types.Header
+	Tds       []*big.Int
+	Proof     *NodeSet
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *ChtRequestList) StoreResult(db mandb.Database) {
+	for i, header := range req.Headers {
+		hash, num := header.Hash(), header.Number.Uint64()
+		rawdb.WriteHeader(db, header)
+		rawdb.WriteTd(db, hash, num, req.Tds[i])
+		rawdb.WriteCanonicalHash(db, hash, num)
+	}
+}
+
+// HeaderRequest is the ODR request type for fetching a single canonical
+// header by block number.
+type HeaderRequest struct {
+	Number uint64
+	Header *types.Header
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *HeaderRequest) StoreResult(db mandb.Database) {
+	hash, num := req.Header.Hash(), req.Header.Number.Uint64()
+	rawdb.WriteHeader(db, req.Header)
+	rawdb.WriteCanonicalHash(db, hash, num)
+}
+
+// ReceiptsRequest is the ODR request type for fetching the receipts of a
+// single block identified by its canonical hash and number.
+type ReceiptsRequest struct {
+	Hash     common.Hash
+	Number   uint64
+	Receipts types.Receipts
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *ReceiptsRequest) StoreResult(db mandb.Database) {
+	rawdb.WriteReceipts(db, req.Hash, req.Number, req.Receipts)
+}
+
+// BloomRequestList is the ODR request type for fetching an arbitrary batch of
+// (bit index, section) bloom-bit vectors against a single BloomTrie root via
+// one MultiProof, e.g. every bit index of one section or one bit index across
+// every section a log filter touches. Like ChtRequestList, it is only used
+// with peers that advertised MultiProofCap; otherwise the request layer falls
+// back to BloomRequest, which serves at most one bit index per round trip.
+type BloomRequestList struct {
+	Config         *IndexerConfig
+	BloomTrieRoot  common.Hash
+	BloomTrieNum   uint64
+	BitIndices     []uint
+	SectionIndices []uint64
+	SectionHeads   []common.Hash
+	BloomBits      [][]byte
+	Proof          *NodeSet
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *BloomRequestList) StoreResult(db mandb.Database) {
+	for i, bitIdx := range req.BitIndices {
+		rawdb.WriteBloomBits(db, bitIdx, req.SectionIndices[i], req.SectionHeads[i], req.BloomBits[i])
+	}
+}
@@ -17,6 +17,7 @@
 package light
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"math/big"
@@ -47,17 +48,79 @@ const (
 	HelperTrieProcessConfirmations = 256  // number of confirmations before a HelperTrie is generated
 )
 
+// IndexerConfig is a collection of the section sizes and confirmation counts
+// used by the CHT and BloomTrie chain indexers. The client and server of a
+// network normally agree on a single configuration, but private or test
+// networks can supply their own instead of the mainnet-sized defaults.
+type IndexerConfig struct {
+	// section size and confirmations for the CHT indexer
+	ChtSize     uint64
+	PairChtSize uint64 // peer-side CHT section size, used to translate section indices via GetChtV2Root
+	ChtConfirms uint64
+
+	// section size and confirmations for the BloomBits indexer
+	BloomSize     uint64
+	BloomConfirms uint64
+
+	// section size and confirmations for the BloomTrie indexer
+	BloomTrieSize     uint64
+	BloomTrieConfirms uint64
+}
+
+var (
+	// DefaultServerIndexerConfig wraps the legacy server-side section sizes.
+	DefaultServerIndexerConfig = &IndexerConfig{
+		ChtSize:           CHTFrequencyServer,
+		PairChtSize:       CHTFrequencyClient,
+		ChtConfirms:       HelperTrieProcessConfirmations,
+		BloomSize:         manBloomBitsSection,
+		BloomConfirms:     manBloomBitsConfirmations,
+		BloomTrieSize:     BloomTrieFrequency,
+		BloomTrieConfirms: HelperTrieProcessConfirmations,
+	}
+	// DefaultClientIndexerConfig wraps the legacy client-side section sizes.
+	DefaultClientIndexerConfig = &IndexerConfig{
+		ChtSize:           CHTFrequencyClient,
+		PairChtSize:       CHTFrequencyServer,
+		ChtConfirms:       HelperTrieConfirmations,
+		BloomSize:         BloomTrieFrequency,
+		BloomConfirms:     manBloomBitsConfirmations,
+		BloomTrieSize:     BloomTrieFrequency,
+		BloomTrieConfirms: HelperTrieConfirmations,
+	}
+	// TestIndexerConfig uses small section sizes so indexer tests do not need
+	// to generate tens of thousands of blocks worth of fixtures.
+	TestIndexerConfig = &IndexerConfig{
+		ChtSize:           256,
+		PairChtSize:       2048,
+		ChtConfirms:       32,
+		BloomSize:         256,
+		BloomConfirms:     32,
+		BloomTrieSize:     2048,
+		BloomTrieConfirms: 32,
+	}
+)
+
 // trustedCheckpoint represents a set of post-processed trie roots (CHT and BloomTrie) associated with
 // the appropriate section index and head hash. It is used to start light syncing from this checkpoint
 // and avoid downloading the entire header chain while still being able to securely access old headers/logs.
+//
+// A checkpoint may optionally carry a set of trusted signer addresses and a
+// signature threshold. When present, a light client that trusts this
+// checkpoint may also accept new-head announcements signed by at least
+// signersThreshold of trustedSigners instead of verifying the header's PoW,
+// see VerifySignedAnnouncement.
 type trustedCheckpoint struct {
 	name                                string
 	sectionIdx                          uint64
 	sectionHead, chtRoot, bloomTrieRoot common.Hash
+
+	trustedSigners   []common.Address
+	signersThreshold int
 }
 
 var (
-	mainnetCheckpoint = trustedCheckpoint{
+	mainnetCheckpoint = &trustedCheckpoint{
 		name:          "mainnet",
 		sectionIdx:    170,
 		sectionHead:   common.HexToHash("3bb2c28bcce463d57968f14f56cdb3fbf35349ab7a701f44c1afb57349c9a356"),
@@ -65,7 +128,7 @@ var (
 		bloomTrieRoot: common.HexToHash("e4e8250a2fefddead7ae42daecd848cbf9b66d748a8270f8bbd4370b764bb9e9"),
 	}
 
-	ropstenCheckpoint = trustedCheckpoint{
+	ropstenCheckpoint = &trustedCheckpoint{
 		name:          "ropsten",
 		sectionIdx:    97,
 		sectionHead:   common.HexToHash("719448c67c01eb5b9f27833a36a4e34612f66801316d7ff37daf9e77fb4cd095"),
@@ -74,8 +137,10 @@ var (
 	}
 )
 
-// trustedCheckpoints associates each known checkpoint with the genesis hash of the chain it belongs to
-var trustedCheckpoints = map[common.Hash]trustedCheckpoint{
+// trustedCheckpoints associates each known checkpoint with the genesis hash of the chain it belongs to.
+// Checkpoints are held by pointer so that EnableUltraLight can attach a trusted signer set to one of them
+// after the fact, once the operator's signer config has been loaded.
+var trustedCheckpoints = map[common.Hash]*trustedCheckpoint{
 	params.MainnetGenesisHash: mainnetCheckpoint,
 	params.TestnetGenesisHash: ropstenCheckpoint,
 }
@@ -104,9 +169,25 @@ func GetChtRoot(db mandb.Database, sectionIdx uint64, sectionHead common.Hash) c
 }
 
 // GetChtV2Root reads the CHT root assoctiated to the given section from the database
-// Note that sectionIdx is specified according to LES/2 CHT section size
-func GetChtV2Root(db mandb.Database, sectionIdx uint64, sectionHead common.Hash) common.Hash {
-	return GetChtRoot(db, (sectionIdx+1)*(CHTFrequencyClient/CHTFrequencyServer)-1, sectionHead)
+// Note that sectionIdx is specified according to the peer's (LES/2) CHT section size,
+// as carried by config.PairChtSize, and is translated to our own section size before lookup.
+func GetChtV2Root(db mandb.Database, sectionIdx uint64, sectionHead common.Hash, config *IndexerConfig) common.Hash {
+	return GetChtRoot(db, (sectionIdx+1)*(config.PairChtSize/config.ChtSize)-1, sectionHead)
+}
+
+// ChtNodeInfo returns the latest locally known CHT section index, head and
+// root, in the form used to advertise a node's CHT coverage to peers during
+// the LES handshake (see les.NodeInfo).
+func ChtNodeInfo(odr OdrBackend) (sectionIdx uint64, sectionHead, root common.Hash) {
+	chtIndexer := odr.ChtIndexer()
+	sectionIdx, _, _ = chtIndexer.Sections()
+	if sectionIdx == 0 {
+		return 0, common.Hash{}, common.Hash{}
+	}
+	sectionIdx--
+	sectionHead = chtIndexer.SectionHead(sectionIdx)
+	root = GetChtRoot(odr.Database(), sectionIdx, sectionHead)
+	return sectionIdx, sectionHead, root
 }
 
 // StoreChtRoot writes the CHT root assoctiated to the given section into the database
@@ -119,46 +200,84 @@ func StoreChtRoot(db mandb.Database, sectionIdx uint64, sectionHead, root common
 
 // ChtIndexerBackend implements core.ChainIndexerBackend
 type ChtIndexerBackend struct {
-	diskdb               mandb.Database
-	triedb               *trie.Database
-	section, sectionSize uint64
-	lastHash             common.Hash
-	trie                 *trie.Trie
+	diskdb   mandb.Database
+	triedb   *trie.Database
+	odr      OdrBackend
+	config   *IndexerConfig
+	section  uint64
+	lastHash common.Hash
+	trie     *trie.Trie
 }
 
-// NewBloomTrieIndexer creates a BloomTrie chain indexer
-func NewChtIndexer(db mandb.Database, clientMode bool) *core.ChainIndexer {
-	var sectionSize, confirmReq uint64
-	if clientMode {
-		sectionSize = CHTFrequencyClient
-		confirmReq = HelperTrieConfirmations
-	} else {
-		sectionSize = CHTFrequencyServer
-		confirmReq = HelperTrieProcessConfirmations
-	}
+// NewChtIndexer creates a CHT chain indexer with the section size and
+// confirmation count taken from config. If odr is non-nil, the indexer runs
+// in light mode: when the section's starting trie is not available locally,
+// Reset bootstraps it by fetching the missing nodes from the network via ODR.
+// Light mode does not change Process: the td of every processed header is
+// still read from the local database, with no ODR fallback.
+func NewChtIndexer(db mandb.Database, odr OdrBackend, config *IndexerConfig) *core.ChainIndexer {
 	idb := mandb.NewTable(db, "chtIndex-")
 	backend := &ChtIndexerBackend{
-		diskdb:      db,
-		triedb:      trie.NewDatabase(mandb.NewTable(db, ChtTablePrefix)),
-		sectionSize: sectionSize,
+		diskdb: db,
+		odr:    odr,
+		config: config,
+		triedb: trie.NewDatabase(mandb.NewTable(db, ChtTablePrefix)),
+	}
+	return core.NewChainIndexer(db, idb, backend, config.ChtSize, config.ChtConfirms, time.Millisecond*100, "cht")
+}
+
+// fetchMissingNodes retrieves the Merkle proof of the last key of the
+// previous section (the section head's canonical header) via ODR and inserts
+// the returned proof nodes into the local trie database, leaving just enough
+// of the trie in place to resume inserting entries for the new section.
+func (c *ChtIndexerBackend) fetchMissingNodes(ctx context.Context, section uint64, root common.Hash) error {
+	r := &ChtRequest{Config: c.config, ChtRoot: root, ChtNum: section - 1, BlockNum: section*c.config.ChtSize - 1}
+	for {
+		err := c.odr.Retrieve(ctx, r)
+		switch err {
+		case nil:
+			r.Proof.Store(c.triedb.DiskDB())
+			return nil
+		case ErrNoPeers:
+			// if there are no peers to serve, retry later
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second * 10):
+				// try again
+			}
+		default:
+			return err
+		}
 	}
-	return core.NewChainIndexer(db, idb, backend, sectionSize, confirmReq, time.Millisecond*100, "cht")
 }
 
 // Reset implements core.ChainIndexerBackend
-func (c *ChtIndexerBackend) Reset(section uint64, lastSectionHead common.Hash) error {
+func (c *ChtIndexerBackend) Reset(ctx context.Context, section uint64, lastSectionHead common.Hash) error {
 	var root common.Hash
 	if section > 0 {
 		root = GetChtRoot(c.diskdb, section-1, lastSectionHead)
 	}
 	var err error
 	c.trie, err = trie.New(root, c.triedb)
+	if err != nil && c.odr != nil {
+		err = c.fetchMissingNodes(ctx, section, root)
+		if err == nil {
+			c.trie, err = trie.New(root, c.triedb)
+		}
+	}
 	c.section = section
 	return err
 }
 
-// Process implements core.ChainIndexerBackend
-func (c *ChtIndexerBackend) Process(header *types.Header) {
+// Process implements core.ChainIndexerBackend. header's td must already be
+// present locally: it was written when header was inserted into the chain,
+// before the indexer ever saw it. There is no ODR fallback for a missing td
+// here, unlike Reset's bootstrap proof — header belongs to the section
+// currently being built (c.section), which has no committed CHT root yet to
+// prove anything against; only already-committed, prior sections can be
+// fetched via ChtRequest.
+func (c *ChtIndexerBackend) Process(ctx context.Context, header *types.Header) error {
 	hash, num := header.Hash(), header.Number.Uint64()
 	c.lastHash = hash
 
@@ -170,6 +289,7 @@ func (c *ChtIndexerBackend) Process(header *types.Header) {
 	binary.BigEndian.PutUint64(encNumber[:], num)
 	data, _ := rlp.EncodeToBytes(ChtNode{hash, td})
 	c.trie.Update(encNumber[:], data)
+	return nil
 }
 
 // Commit implements core.ChainIndexerBackend
@@ -180,8 +300,8 @@ func (c *ChtIndexerBackend) Commit() error {
 	}
 	c.triedb.Commit(root, false)
 
-	if ((c.section+1)*c.sectionSize)%CHTFrequencyClient == 0 {
-		log.Info("Storing CHT", "section", c.section*c.sectionSize/CHTFrequencyClient, "head", c.lastHash, "root", root)
+	if ((c.section+1)*c.config.ChtSize)%c.config.PairChtSize == 0 {
+		log.Info("Storing CHT", "section", c.section*c.config.ChtSize/c.config.PairChtSize, "head", c.lastHash, "root", root)
 	}
 	StoreChtRoot(c.diskdb, c.section, c.lastHash, root)
 	return nil
@@ -215,56 +335,106 @@ func StoreBloomTrieRoot(db mandb.Database, sectionIdx uint64, sectionHead, root
 
 // BloomTrieIndexerBackend implements core.ChainIndexerBackend
 type BloomTrieIndexerBackend struct {
-	diskdb                                     mandb.Database
-	triedb                                     *trie.Database
-	section, parentSectionSize, bloomTrieRatio uint64
-	trie                                       *trie.Trie
-	sectionHeads                               []common.Hash
+	diskdb         mandb.Database
+	triedb         *trie.Database
+	odr            OdrBackend
+	config         *IndexerConfig
+	bloomTrieRatio uint64
+	section        uint64
+	trie           *trie.Trie
+	sectionHeads   []common.Hash
 }
 
-// NewBloomTrieIndexer creates a BloomTrie chain indexer
-func NewBloomTrieIndexer(db mandb.Database, clientMode bool) *core.ChainIndexer {
+// NewBloomTrieIndexer creates a BloomTrie chain indexer with the section size
+// and confirmation counts taken from config. If odr is non-nil, the indexer
+// runs in light mode: Reset bootstraps the section's starting trie via ODR
+// and Commit fetches any bloom bit vector it needs to fold into the new
+// section via ODR when that vector is missing from the local database.
+func NewBloomTrieIndexer(db mandb.Database, odr OdrBackend, config *IndexerConfig) *core.ChainIndexer {
 	backend := &BloomTrieIndexerBackend{
 		diskdb: db,
+		odr:    odr,
+		config: config,
 		triedb: trie.NewDatabase(mandb.NewTable(db, BloomTrieTablePrefix)),
 	}
 	idb := mandb.NewTable(db, "bltIndex-")
 
-	var confirmReq uint64
-	if clientMode {
-		backend.parentSectionSize = BloomTrieFrequency
-		confirmReq = HelperTrieConfirmations
-	} else {
-		backend.parentSectionSize = manBloomBitsSection
-		confirmReq = HelperTrieProcessConfirmations
-	}
-	backend.bloomTrieRatio = BloomTrieFrequency / backend.parentSectionSize
+	backend.bloomTrieRatio = config.BloomTrieSize / config.BloomSize
 	backend.sectionHeads = make([]common.Hash, backend.bloomTrieRatio)
-	return core.NewChainIndexer(db, idb, backend, BloomTrieFrequency, confirmReq-manBloomBitsConfirmations, time.Millisecond*100, "bloomtrie")
+	return core.NewChainIndexer(db, idb, backend, config.BloomTrieSize, config.BloomTrieConfirms-config.BloomConfirms, time.Millisecond*100, "bloomtrie")
+}
+
+// fetchMissingNodes retrieves the Merkle proof of the last bit index of the
+// previous BloomTrie section via ODR and inserts the returned proof nodes
+// into the local trie database. It uses a BloomRequest rather than a
+// ChtRequest: the BloomTrie and CHT are two different tries, keyed and
+// rooted independently, and a CHT proof would verify against the wrong root.
+func (b *BloomTrieIndexerBackend) fetchMissingNodes(ctx context.Context, section uint64, root common.Hash) error {
+	r := &BloomRequest{Config: b.config, BloomTrieRoot: root, BloomTrieNum: section - 1, BitIdx: types.BloomBitLength - 1, SectionIndexList: []uint64{section - 1}}
+	for {
+		err := b.odr.Retrieve(ctx, r)
+		switch err {
+		case nil:
+			r.Proofs.Store(b.triedb.DiskDB())
+			return nil
+		case ErrNoPeers:
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second * 10):
+				// try again
+			}
+		default:
+			return err
+		}
+	}
 }
 
 // Reset implements core.ChainIndexerBackend
-func (b *BloomTrieIndexerBackend) Reset(section uint64, lastSectionHead common.Hash) error {
+func (b *BloomTrieIndexerBackend) Reset(ctx context.Context, section uint64, lastSectionHead common.Hash) error {
 	var root common.Hash
 	if section > 0 {
 		root = GetBloomTrieRoot(b.diskdb, section-1, lastSectionHead)
 	}
 	var err error
 	b.trie, err = trie.New(root, b.triedb)
+	if err != nil && b.odr != nil {
+		err = b.fetchMissingNodes(ctx, section, root)
+		if err == nil {
+			b.trie, err = trie.New(root, b.triedb)
+		}
+	}
 	b.section = section
 	return err
 }
 
 // Process implements core.ChainIndexerBackend
-func (b *BloomTrieIndexerBackend) Process(header *types.Header) {
-	num := header.Number.Uint64() - b.section*BloomTrieFrequency
-	if (num+1)%b.parentSectionSize == 0 {
-		b.sectionHeads[num/b.parentSectionSize] = header.Hash()
+func (b *BloomTrieIndexerBackend) Process(ctx context.Context, header *types.Header) error {
+	num := header.Number.Uint64() - b.section*b.config.BloomTrieSize
+	if (num+1)%b.config.BloomSize == 0 {
+		b.sectionHeads[num/b.config.BloomSize] = header.Hash()
+	}
+	return nil
+}
+
+// retrieveBloomBits fetches the compressed bloom bit vector for the given
+// bit index and parent section, either from the local database or, if
+// running in light mode, via an ODR BloomRequest. The caller decompresses it.
+func (b *BloomTrieIndexerBackend) retrieveBloomBits(ctx context.Context, bitIdx uint, parentSection uint64, sectionHead common.Hash) ([]byte, error) {
+	data, err := rawdb.ReadBloomBits(b.diskdb, bitIdx, parentSection, sectionHead)
+	if err == nil || b.odr == nil {
+		return data, err
+	}
+	r := &BloomRequest{Config: b.config, BitIdx: bitIdx, SectionIndexList: []uint64{parentSection}, SectionHeadList: []common.Hash{sectionHead}}
+	if err := b.odr.Retrieve(ctx, r); err != nil {
+		return nil, err
 	}
+	return r.BloomBits[0], nil
 }
 
 // Commit implements core.ChainIndexerBackend
 func (b *BloomTrieIndexerBackend) Commit() error {
+	ctx := context.Background()
 	var compSize, decompSize uint64
 
 	for i := uint(0); i < types.BloomBitLength; i++ {
@@ -273,11 +443,11 @@ func (b *BloomTrieIndexerBackend) Commit() error {
 		binary.BigEndian.PutUint64(encKey[2:10], b.section)
 		var decomp []byte
 		for j := uint64(0); j < b.bloomTrieRatio; j++ {
-			data, err := rawdb.ReadBloomBits(b.diskdb, i, b.section*b.bloomTrieRatio+j, b.sectionHeads[j])
+			data, err := b.retrieveBloomBits(ctx, i, b.section*b.bloomTrieRatio+j, b.sectionHeads[j])
 			if err != nil {
 				return err
 			}
-			decompData, err2 := bitutil.DecompressBytes(data, int(b.parentSectionSize/8))
+			decompData, err2 := bitutil.DecompressBytes(data, int(b.config.BloomSize/8))
 			if err2 != nil {
 				return err2
 			}
@@ -0,0 +1,114 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package light
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/rawdb"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/trie"
+)
+
+// checkIndexerConfig asserts the invariants every IndexerConfig preset must
+// satisfy for NewBloomTrieIndexer's bloomTrieRatio and confirmation-delta
+// math to make sense: the BloomTrie section must be an exact multiple of the
+// BloomBits section it folds together, and it must be confirmed no earlier
+// than the BloomBits section it depends on.
+func checkIndexerConfig(t *testing.T, name string, config *IndexerConfig) {
+	t.Helper()
+	if config.BloomSize == 0 || config.BloomTrieSize%config.BloomSize != 0 {
+		t.Errorf("%s: BloomTrieSize (%d) is not a multiple of BloomSize (%d)", name, config.BloomTrieSize, config.BloomSize)
+	}
+	if config.BloomTrieConfirms < config.BloomConfirms {
+		t.Errorf("%s: BloomTrieConfirms (%d) is less than BloomConfirms (%d)", name, config.BloomTrieConfirms, config.BloomConfirms)
+	}
+}
+
+func TestDefaultIndexerConfigs(t *testing.T) {
+	checkIndexerConfig(t, "DefaultServerIndexerConfig", DefaultServerIndexerConfig)
+	checkIndexerConfig(t, "DefaultClientIndexerConfig", DefaultClientIndexerConfig)
+	checkIndexerConfig(t, "TestIndexerConfig", TestIndexerConfig)
+
+	if DefaultServerIndexerConfig.BloomTrieSize != BloomTrieFrequency {
+		t.Errorf("DefaultServerIndexerConfig.BloomTrieSize = %d, want %d", DefaultServerIndexerConfig.BloomTrieSize, BloomTrieFrequency)
+	}
+	if DefaultClientIndexerConfig.BloomConfirms != manBloomBitsConfirmations {
+		t.Errorf("DefaultClientIndexerConfig.BloomConfirms = %d, want %d", DefaultClientIndexerConfig.BloomConfirms, manBloomBitsConfirmations)
+	}
+}
+
+func TestGetChtV2Root(t *testing.T) {
+	db := mandb.NewMemDatabase()
+	config := TestIndexerConfig
+	ratio := config.PairChtSize / config.ChtSize
+
+	// Section 2 in the peer's (larger) CHT size maps to our own section
+	// (2+1)*ratio-1, as GetChtV2Root computes it.
+	ourSection := (uint64(2)+1)*ratio - 1
+	head := common.HexToHash("0x01")
+	root := common.HexToHash("0x02")
+	StoreChtRoot(db, ourSection, head, root)
+
+	if got := GetChtV2Root(db, 2, head, config); got != root {
+		t.Fatalf("GetChtV2Root = %x, want %x", got, root)
+	}
+}
+
+func TestChtIndexerProcessRequiresLocalTd(t *testing.T) {
+	db := mandb.NewMemDatabase()
+	backend := &ChtIndexerBackend{diskdb: db, config: TestIndexerConfig, triedb: trie.NewDatabase(mandb.NewTable(db, ChtTablePrefix))}
+	if err := backend.Reset(context.Background(), 0, common.Hash{}); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+
+	header := &types.Header{Number: big.NewInt(1)}
+
+	// Process panics with a nil value, which recover() reports as nil on
+	// older Go versions, so the check is whether Process returned normally.
+	returned := false
+	defer func() {
+		recover()
+		if returned {
+			t.Fatal("Process did not panic on a header with no locally stored td")
+		}
+	}()
+	backend.Process(context.Background(), header)
+	returned = true
+}
+
+func TestChtIndexerProcessWithLocalTd(t *testing.T) {
+	db := mandb.NewMemDatabase()
+	backend := &ChtIndexerBackend{diskdb: db, config: TestIndexerConfig, triedb: trie.NewDatabase(mandb.NewTable(db, ChtTablePrefix))}
+	if err := backend.Reset(context.Background(), 0, common.Hash{}); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+
+	header := &types.Header{Number: big.NewInt(1)}
+	rawdb.WriteTd(db, header.Hash(), header.Number.Uint64(), big.NewInt(1000))
+
+	if err := backend.Process(context.Background(), header); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if backend.lastHash != header.Hash() {
+		t.Fatalf("lastHash = %x, want %x", backend.lastHash, header.Hash())
+	}
+}